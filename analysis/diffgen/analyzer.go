@@ -0,0 +1,153 @@
+// Package diffgen provides a go/analysis Analyzer that flags stale
+// diffgen-generated files. Any type declaration annotated with the
+// directive comment
+//
+//	//diffgen:generate
+//
+// is regenerated in memory via diffgen.Generate and compared against
+// the on-disk <type>_diffgen.go; a mismatch (or a missing file) is
+// reported as a diagnostic, with a SuggestedFix carrying the fresh
+// source when the generated file already exists to fix.
+package diffgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+
+	diffgenlib "github.com/hhhapz/diffgen"
+)
+
+const directive = "diffgen:generate"
+
+// generatedHeaderRE matches the "Code generated by ..." header line Generate
+// writes (generate.go's GeneratedBy). The analyzer has no way to reconstruct
+// the exact invocation a real `go generate` run used to produce the on-disk
+// file, so that line is stripped from both sides before comparing rather
+// than compared byte-for-byte.
+var generatedHeaderRE = regexp.MustCompile(`(?m)^// Code generated by ".*"; DO NOT EDIT\.\n`)
+
+// stripGeneratedHeader removes the "Code generated by ..." header line so
+// staleness is judged on the generated body, not on free-form header text
+// that depends on how diffgen happened to be invoked.
+func stripGeneratedHeader(src []byte) []byte {
+	return generatedHeaderRE.ReplaceAll(src, nil)
+}
+
+// Analyzer reports diffgen-generated files that are out of date with
+// respect to the type they were generated from.
+var Analyzer = &analysis.Analyzer{
+	Name: "diffgen",
+	Doc:  "report stale diffgen-generated <type>_diffgen.go files",
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok || !hasDirective(ts.Doc) && !hasDirective(gd.Doc) {
+					continue
+				}
+				checkType(pass, file, ts)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// hasDirective reports whether doc contains a //diffgen:generate line.
+func hasDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+		if text == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// checkType regenerates ts's diff functions in memory and reports a
+// diagnostic if they differ from the on-disk <type>_diffgen.go.
+func checkType(pass *analysis.Pass, file *ast.File, ts *ast.TypeSpec) {
+	typeName := ts.Name.Name
+	dir := filepath.Dir(pass.Fset.Position(file.Pos()).Filename)
+
+	// go/analysis doesn't expose a *packages.Package for the pass, so
+	// reload the containing directory as its own package to satisfy
+	// Generate's signature. This duplicates work packages.Load already
+	// did to build the pass, but keeps Generate's signature exactly as
+	// specified rather than reshaping it around the analyzer.
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedCompiledGoFiles | packages.NeedName | packages.NeedSyntax | packages.NeedTypesInfo | packages.NeedTypes | packages.NeedImports | packages.NeedDeps,
+		Dir:  dir,
+	}, ".")
+	if err != nil || len(pkgs) != 1 {
+		pass.Reportf(ts.Pos(), "diffgen: could not reload package to check %s: %v", typeName, err)
+		return
+	}
+
+	fresh, err := diffgenlib.Generate(pkgs[0], typeName, diffgenlib.Options{
+		GeneratedBy: "-type " + typeName,
+	})
+	if err != nil {
+		pass.Reportf(ts.Pos(), "diffgen: %v", err)
+		return
+	}
+
+	outName := strings.ToLower(typeName) + "_diffgen.go"
+	outPath := filepath.Join(dir, outName)
+	existing, err := os.ReadFile(outPath)
+	if err != nil {
+		pass.Reportf(ts.Pos(), "diffgen: %s does not exist; run go generate", outName)
+		return
+	}
+	if bytes.Equal(stripGeneratedHeader(existing), stripGeneratedHeader(fresh)) {
+		return
+	}
+
+	diag := analysis.Diagnostic{
+		Pos:     ts.Pos(),
+		Message: fmt.Sprintf("diffgen: %s is stale; run go generate", outName),
+	}
+	if genFile := fileNamed(pass, outPath); genFile != nil {
+		diag.SuggestedFixes = []analysis.SuggestedFix{{
+			Message: fmt.Sprintf("regenerate %s", outName),
+			TextEdits: []analysis.TextEdit{{
+				Pos:     genFile.Pos(),
+				End:     genFile.End(),
+				NewText: fresh,
+			}},
+		}}
+	}
+	pass.Report(diag)
+}
+
+// fileNamed returns the *ast.File among pass.Files backed by path, so a
+// SuggestedFix can anchor its TextEdit to a position the analysis
+// framework recognizes.
+func fileNamed(pass *analysis.Pass, path string) *ast.File {
+	want := filepath.Clean(path)
+	for _, f := range pass.Files {
+		if filepath.Clean(pass.Fset.Position(f.Pos()).Filename) == want {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package diffgen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/packages"
+
+	diffgenlib "github.com/hhhapz/diffgen"
+)
+
+// TestFreshFileNotStale is the round-trip check the review asked for: a
+// sample_diffgen.go produced by a real `go generate` run (GeneratedBy set
+// to the bare CLI args, per cmd/diffgen) must not be flagged stale just
+// because the analyzer's own in-memory regen records a different
+// GeneratedBy string. Before the fix, the header text could never match
+// and this case reported a diagnostic unconditionally.
+func TestFreshFileNotStale(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "go.mod", "module fresh\n\ngo 1.21\n")
+	write(t, dir, "sample.go", `package main
+
+//diffgen:generate
+type Sample struct {
+	Name string
+}
+`)
+
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedCompiledGoFiles | packages.NeedName | packages.NeedSyntax | packages.NeedTypesInfo | packages.NeedTypes | packages.NeedImports | packages.NeedDeps,
+		Dir:  dir,
+	}, ".")
+	if err != nil || len(pkgs) != 1 {
+		t.Fatalf("packages.Load: %d pkgs, err %v", len(pkgs), err)
+	}
+	src, err := diffgenlib.Generate(pkgs[0], "Sample", diffgenlib.Options{
+		GeneratedBy: "-type Sample -output sample_diffgen.go",
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	write(t, dir, "sample_diffgen.go", string(src))
+
+	results := analysistest.Run(t, dir, Analyzer, ".")
+	for _, r := range results {
+		if len(r.Diagnostics) != 0 {
+			t.Fatalf("got %d diagnostics for an up-to-date file, want 0: %v", len(r.Diagnostics), r.Diagnostics)
+		}
+	}
+}
+
+// TestStaleFileReported checks that header-stripping doesn't mask genuine
+// staleness: a sample_diffgen.go that no longer matches the type (an extra
+// field was added) must still be reported, want comment included.
+func TestStaleFileReported(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "go.mod", "module stale\n\ngo 1.21\n")
+	write(t, dir, "sample.go", `package main
+
+//diffgen:generate
+type Sample struct { // want "diffgen: sample_diffgen.go is stale; run go generate"
+	Name string
+	Age  int
+}
+`)
+	write(t, dir, "sample_diffgen.go", `// Code generated by "diffgen -type Sample"; DO NOT EDIT.
+
+package main
+
+type Diff struct {
+	Path []string
+	A, B any
+}
+
+func CompareSample(a, b Sample) (diff []Diff) {
+	if a.Name != b.Name {
+		diff = append(diff, Diff{Path: []string{"Name"}, A: a.Name, B: b.Name})
+	}
+	return diff
+}
+`)
+
+	analysistest.Run(t, dir, Analyzer, ".")
+}
+
+func write(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir for %s: %v", name, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
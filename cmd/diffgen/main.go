@@ -0,0 +1,78 @@
+// Command diffgen generates CompareT and ApplyT functions (and, with
+// -format jsonpatch, RFC 6902 JSON Patch helpers) for a struct type, intended to
+// be driven by a //go:generate directive next to the type it targets.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+
+	diffgen "github.com/hhhapz/diffgen"
+)
+
+var (
+	typeName = flag.String("type", "", "the source type to generate the diff from")
+	skip     = flag.Bool("skip", false, "skip unhandled or unknown types instead of failing")
+	output   = flag.String("output", "", "output file name; default srcdir/<type>_diffgen.go")
+	methods  = flag.Bool("methods", false, "include methods in diff")
+	format   = flag.String("format", "diff", "output format: \"diff\" for []Diff, \"jsonpatch\" to also emit an RFC 6902 []Operation writer")
+	maxDepth = flag.Int("max-depth", 32, "maximum struct nesting depth to generate comparisons for; 0 disables the limit")
+)
+
+func Usage() {
+	fmt.Fprintf(os.Stderr, "Usage of diffgen:\n")
+	fmt.Fprintf(os.Stderr, "\tdiffgen [flags] -type T [directory]\n")
+	fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("diffgen: ")
+	flag.Usage = Usage
+	flag.Parse()
+	if len(*typeName) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	args := flag.Args()
+	if len(args) == 0 {
+		// process whole package
+		args = []string{"."}
+	}
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedCompiledGoFiles | packages.NeedName | packages.NeedSyntax | packages.NeedTypesInfo | packages.NeedTypes | packages.NeedImports | packages.NeedDeps,
+	}, args...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(pkgs) != 1 {
+		log.Fatalf("error: %d packages found", len(pkgs))
+	}
+	src, err := diffgen.Generate(pkgs[0], *typeName, diffgen.Options{
+		Skip:        *skip,
+		Methods:     *methods,
+		Format:      *format,
+		MaxDepth:    *maxDepth,
+		GeneratedBy: strings.Join(os.Args[1:], " "),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *output == "" {
+		*output = strings.ToLower(*typeName) + "_diffgen.go"
+	}
+	f := os.Stdout
+	if *output != "-" {
+		f, err = os.Create(*output)
+		if err != nil {
+			log.Fatalf("could not create file %s: %v", *output, err)
+		}
+	}
+	f.Write(src)
+}
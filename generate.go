@@ -0,0 +1,1063 @@
+// Package diffgen generates CompareT and ApplyT functions (and, depending
+// on Options, JSON Patch helpers) from a struct type's field layout. It is consumed both by the cmd/diffgen CLI (driven by `go
+// generate`) and by the analysis/diffgen Analyzer, which calls Generate
+// directly to check that a checked-in <type>_diffgen.go file is still
+// up to date.
+package diffgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	goformat "go/format"
+	"go/types"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/imports"
+)
+
+var hasMap bool
+
+// Tag-driven metadata collected while walking the struct, keyed by the
+// dotted Go field path (e.g. "Parent.Children") it was declared on. These
+// are populated by ProcessStruct from the `diffgen:"..."` struct tag and
+// consulted later by WriteComparisons, mirroring the hasMap side channel
+// above rather than threading extra parameters through every recursive
+// call.
+var (
+	renames   = map[string]string{} // diffgen:"name=..."
+	sliceKeys = map[string]string{} // diffgen:"key=..."
+	sliceElem = map[string]string{} // element type string for a keyed slice
+	fieldCmp  = map[string]string{} // diffgen:"cmp=...", the selector to call
+
+	// cmpImports collects the import paths referenced by diffgen:"cmp=..."
+	// selectors that named a full import path (as opposed to a function in
+	// the generated package itself), so Generate can add them to the
+	// output explicitly instead of relying on goimports to guess a package
+	// path from a bare identifier.
+	cmpImports = map[string]bool{}
+
+	// equalTypes and stringerTypes record named types (keyed the same way
+	// as the maps above) that were left as leaves by ProcessType because
+	// they implement Equal(T) bool or String() string, rather than being
+	// recursed into field-by-field.
+	equalTypes    = map[string]bool{}
+	stringerTypes = map[string]bool{}
+
+	// cyclicTypes records leaves where ProcessType (or ProcessStruct)
+	// stopped recursing because the named type was already on the
+	// current path (a self-referential struct graph), because -max-depth
+	// truncated the walk first, or because the type is a non-comparable
+	// struct with no exported fields and no String method; all fall back
+	// to the same runtime reflect.DeepEqual comparison in WriteComparisons
+	// rather than silently emitting no comparison for the subtree.
+	cyclicTypes = map[string]bool{}
+
+	typesPkg *types.Package
+)
+
+// skip, methods, format and maxDepth mirror the corresponding Options
+// fields for the duration of a single Generate call; ProcessStruct,
+// ProcessType and WriteComparisons read them the same way they read the
+// maps above, rather than threading an Options value through every
+// recursive call.
+var (
+	skip     bool
+	methods  bool
+	format   string
+	maxDepth int
+)
+
+// Options controls how Generate lays out the generated CompareT (and
+// ApplyT/JSON Patch) functions. The zero value matches the CLI's
+// defaults except for MaxDepth: unhandled types are fatal, methods are
+// excluded, and only the []Diff-producing "diff" format is emitted, but
+// a zero MaxDepth disables the depth limit where the CLI defaults to 32.
+type Options struct {
+	// Skip makes unhandled or unknown field types a warning instead of
+	// an error; Generate simply omits them from the comparison.
+	Skip bool
+	// Methods includes exported methods in the generated diff.
+	Methods bool
+	// Format selects the output mode: "diff" for []Diff, or
+	// "jsonpatch" to also emit an RFC 6902 []Operation writer.
+	Format string
+	// MaxDepth bounds struct nesting depth to guard against runaway
+	// recursion on self-referential types; 0 disables the limit.
+	MaxDepth int
+	// GeneratedBy is recorded in the "Code generated by ..." header after
+	// the word "diffgen", conventionally the arguments the CLI was invoked
+	// with (without the program name).
+	GeneratedBy string
+}
+
+// resetGeneratorState clears the side-channel state ProcessStruct,
+// ProcessType and WriteComparisons accumulate while walking a type, so
+// that a single process can call Generate repeatedly (e.g. once per
+// //diffgen:generate comment found by the Analyzer) without state from
+// one type leaking into the next.
+func resetGeneratorState() {
+	hasMap = false
+	renames = map[string]string{}
+	sliceKeys = map[string]string{}
+	sliceElem = map[string]string{}
+	fieldCmp = map[string]string{}
+	cmpImports = map[string]bool{}
+	equalTypes = map[string]bool{}
+	stringerTypes = map[string]bool{}
+	cyclicTypes = map[string]bool{}
+}
+
+// Generate discovers typeName in pkg, builds its Comparisons tree, and
+// returns the formatted source of the generated CompareT and ApplyT
+// (and, per opts, JSON Patch) functions. It does not write the result
+// anywhere; that's left to the caller, whether that's cmd/diffgen
+// writing srcdir/<type>_diffgen.go or the Analyzer diffing the result
+// against what's already on disk.
+func Generate(pkg *packages.Package, typeName string, opts Options) ([]byte, error) {
+	resetGeneratorState()
+	skip = opts.Skip
+	methods = opts.Methods
+	format = opts.Format
+	if format == "" {
+		format = "diff"
+	}
+	maxDepth = opts.MaxDepth
+
+	d := DiffGen{Package: pkg}
+	typesPkg = d.Package.Types
+	if err := d.ParseBase(typeName); err != nil {
+		return nil, err
+	}
+	if d.base == nil {
+		return nil, fmt.Errorf("diffgen: expected to find type %s, found none", typeName)
+	}
+	fields := ProcessStruct(nil, d.base, nil, 0)
+	c := Comparisons{
+		Structs: make(map[string]Comparisons),
+	}
+	for _, path := range fields {
+		c.Add(path)
+	}
+	out := new(bytes.Buffer)
+	fmt.Fprintf(out, "// Code generated by \"diffgen %s\"; DO NOT EDIT.\n", opts.GeneratedBy)
+	fmt.Fprintf(out, "\n")
+	fmt.Fprintf(out, "package %s\n", d.Name)
+	if len(cmpImports) > 0 {
+		paths := make([]string, 0, len(cmpImports))
+		for p := range cmpImports {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		fmt.Fprintf(out, "\nimport (\n")
+		for _, p := range paths {
+			fmt.Fprintf(out, "\t%q\n", p)
+		}
+		fmt.Fprintf(out, ")\n")
+	}
+	fmt.Fprintf(out, `
+type Diff struct {
+	Path []string
+	A    any
+	B    any
+}
+
+func mkDiff(path []string, a, b any) Diff {
+	return Diff{slices.Clone(path), a, b}
+}
+
+func Compare%[1]s(a, b %[1]s) (diff []Diff) {
+`, typeName)
+	c.WriteComparisons(out, "\t", false)
+	fmt.Fprint(out, "\treturn diff\n}\n")
+	writeApplyFuncs(out, typeName)
+	if format == "jsonpatch" {
+		writeJSONPatchFuncs(out)
+	}
+	name := strings.ToLower(typeName) + "_diffgen.go"
+	return formatSource(name, out.Bytes()), nil
+}
+
+// formatSource runs gofmt and goimports over src so the generated file has
+// consistent indentation and an import block computed from what the
+// generated code actually references, rather than a hand-assembled list.
+// If formatting fails (e.g. src doesn't parse), it logs a warning and
+// returns src unchanged so the caller can still be written out for
+// debugging.
+func formatSource(filename string, src []byte) []byte {
+	formatted, err := imports.Process(filename, src, nil)
+	if err == nil {
+		return formatted
+	}
+	log.Printf("warning: goimports failed, falling back to gofmt: %v", err)
+	formatted, err = goformat.Source(src)
+	if err == nil {
+		return formatted
+	}
+	log.Printf("warning: could not format generated source, writing as-is: %v", err)
+	return src
+}
+
+// writeApplyFuncs emits ApplyT, the companion of CompareT that reapplies a
+// []Diff produced by CompareT to a copy of a, so that
+// Apply(a, Compare(a, b)) == b is a testable round-trip invariant. It walks
+// each Diff.Path at runtime via reflect rather than regenerating a typed
+// setter per field, reusing the map[string]string table of
+// diffgen:"key=..." slices (diffgenKeyedFields) so keyed slices are
+// re-parsed by key instead of by index.
+func writeApplyFuncs(w io.Writer, typeName string) {
+	keys := make([]string, 0, len(sliceKeys))
+	for k := range sliceKeys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	table := new(strings.Builder)
+	for _, k := range keys {
+		fmt.Fprintf(table, "\t%q: %q,\n", k, sliceKeys[k])
+	}
+
+	// Build the reverse of renames: a Diff.Path segment produced under a
+	// diffgen:"name=..." rename is the tag's name, not the real Go field
+	// name, so diffgenApply needs "<parent real path>.<renamed name>" ->
+	// real field name to call FieldByName correctly.
+	renameKeys := make([]string, 0, len(renames))
+	for k := range renames {
+		renameKeys = append(renameKeys, k)
+	}
+	sort.Strings(renameKeys)
+	renameTable := new(strings.Builder)
+	for _, k := range renameKeys {
+		parent, realName := "", k
+		if i := strings.LastIndex(k, "."); i >= 0 {
+			parent, realName = k[:i], k[i+1:]
+		}
+		key := renames[k]
+		if parent != "" {
+			key = parent + "." + key
+		}
+		fmt.Fprintf(renameTable, "\t%q: %q,\n", key, realName)
+	}
+
+	fmt.Fprintf(w, `
+// diffgenKeyedFields maps the dotted field path of a diffgen:"key=..."
+// slice to the name of its key field, so Apply%[1]s can re-parse a Diff.Path
+// segment as a key lookup instead of a slice index.
+var diffgenKeyedFields = map[string]string{
+%[2]s}
+
+// diffgenRenamedFields maps "<parent real field path>.<diffgen:"name=..."
+// value>" back to the real Go field name, so Apply%[1]s can resolve a
+// Diff.Path segment produced under a rename back to FieldByName.
+var diffgenRenamedFields = map[string]string{
+%[3]s}
+
+// Apply%[1]s applies diffs produced by Compare%[1]s to a copy of a and
+// returns the result.
+func Apply%[1]s(a %[1]s, diffs []Diff) (%[1]s, error) {
+	out := a
+	rv := reflect.ValueOf(&out).Elem()
+	for _, d := range diffs {
+		if err := diffgenApply(rv, nil, d.Path, d.B); err != nil {
+			return out, fmt.Errorf("diffgen: apply %%v: %%w", d.Path, err)
+		}
+	}
+	return out, nil
+}
+
+// diffgenApply walks v following path, descending through struct fields,
+// map keys and slice/array indices (allocating nil pointers and growing
+// slices as needed), and sets the final element to val. fieldPath tracks
+// only the struct-field segments seen so far (skipping map keys and slice
+// indices), which is how diffgenKeyedFields is keyed; inside an element
+// of a diffgen:"key=..." slice it starts again from empty.
+func diffgenApply(v reflect.Value, fieldPath, path []string, val any) error {
+	if len(path) == 0 {
+		nv := reflect.ValueOf(val)
+		if !nv.IsValid() {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if !nv.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("cannot assign %%T to %%s", val, v.Type())
+		}
+		v.Set(nv)
+		return nil
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			if !v.CanSet() {
+				return fmt.Errorf("cannot allocate nil %%s", v.Type())
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		name := path[0]
+		if real, ok := diffgenRenamedFields[strings.Join(append(slices.Clone(fieldPath), name), ".")]; ok {
+			name = real
+		}
+		fv := v.FieldByName(name)
+		if !fv.IsValid() {
+			return fmt.Errorf("unknown field %%q on %%s", name, v.Type())
+		}
+		return diffgenApply(fv, append(slices.Clone(fieldPath), name), path[1:], val)
+	case reflect.Slice, reflect.Array:
+		if keyField, ok := diffgenKeyedFields[strings.Join(fieldPath, ".")]; ok && v.Kind() == reflect.Slice {
+			return diffgenApplyKeyed(v, keyField, path[0], path[1:], val)
+		}
+		idx, err := strconv.Atoi(path[0])
+		if err != nil {
+			return fmt.Errorf("bad slice index %%q: %%w", path[0], err)
+		}
+		if v.Kind() == reflect.Slice && idx >= v.Len() {
+			grown := reflect.MakeSlice(v.Type(), idx+1, idx+1)
+			reflect.Copy(grown, v)
+			v.Set(grown)
+		}
+		return diffgenApply(v.Index(idx), fieldPath, path[1:], val)
+	case reflect.Map:
+		kv := reflect.New(v.Type().Key()).Elem()
+		if _, err := fmt.Sscan(path[0], kv.Addr().Interface()); err != nil {
+			return fmt.Errorf("bad map key %%q: %%w", path[0], err)
+		}
+		if len(path) == 1 && val == nil {
+			// A leaf diff with no B means the key was removed, not set to
+			// its zero value: drop it instead of reinserting it below.
+			if !v.IsNil() {
+				v.SetMapIndex(kv, reflect.Value{})
+			}
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		ev := reflect.New(v.Type().Elem()).Elem()
+		if cur := v.MapIndex(kv); cur.IsValid() {
+			ev.Set(cur)
+		}
+		if err := diffgenApply(ev, fieldPath, path[1:], val); err != nil {
+			return err
+		}
+		v.SetMapIndex(kv, ev)
+		return nil
+	default:
+		return fmt.Errorf("cannot descend into %%s for path %%q", v.Type(), path[0])
+	}
+}
+
+// diffgenApplyKeyed applies a diff to the slice element whose keyField
+// equals keyStr, appending a new element if none matches and removing the
+// matched element when the diff carries no value and no further path.
+func diffgenApplyKeyed(v reflect.Value, keyField, keyStr string, rest []string, val any) error {
+	for i := 0; i < v.Len(); i++ {
+		if fmt.Sprint(v.Index(i).FieldByName(keyField).Interface()) != keyStr {
+			continue
+		}
+		if len(rest) == 0 && val == nil {
+			v.Set(reflect.AppendSlice(v.Slice(0, i), v.Slice(i+1, v.Len())))
+			return nil
+		}
+		return diffgenApply(v.Index(i), nil, rest, val)
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("diffgen: key %%q not found", keyStr)
+	}
+	nv := reflect.ValueOf(val)
+	if !nv.IsValid() || !nv.Type().AssignableTo(v.Type().Elem()) {
+		return fmt.Errorf("diffgen: cannot append %%T to %%s", val, v.Type().Elem())
+	}
+	v.Set(reflect.Append(v, nv))
+	return nil
+}
+`, typeName, table.String(), renameTable.String())
+}
+
+// writeJSONPatchFuncs emits ToJSONPatch, which translates a []Diff into
+// RFC 6902 JSON Patch operations so a diff can be shipped over the wire and
+// applied by any compliant implementation. A missing A (the map-diff branch
+// reporting mkDiff(path, nil, b[k])) becomes an "add"; a missing B becomes a
+// "remove"; everything else is a "replace".
+func writeJSONPatchFuncs(w io.Writer) {
+	fmt.Fprint(w, `
+// Operation is a single RFC 6902 JSON Patch operation.
+type Operation struct {
+	Op    string ` + "`json:\"op\"`" + `
+	Path  string ` + "`json:\"path\"`" + `
+	Value any    ` + "`json:\"value,omitempty\"`" + `
+}
+
+// ToJSONPatch converts diffs, as produced by CompareT, into RFC 6902 JSON
+// Patch operations.
+func ToJSONPatch(diffs []Diff) []Operation {
+	ops := make([]Operation, 0, len(diffs))
+	for _, d := range diffs {
+		op := "replace"
+		switch {
+		case d.A == nil && d.B != nil:
+			op = "add"
+		case d.A != nil && d.B == nil:
+			op = "remove"
+		}
+		ops = append(ops, Operation{
+			Op:    op,
+			Path:  "/" + strings.Join(d.Path, "/"),
+			Value: d.B,
+		})
+	}
+	return ops
+}
+`)
+}
+
+type DiffGen struct {
+	*packages.Package
+
+	base   *types.Struct
+	prefix string
+}
+
+func (d *DiffGen) ParseBase(typeName string) error {
+	for i := range d.CompiledGoFiles {
+		file := d.Syntax[i]
+		for _, decl := range file.Decls {
+			g, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, s := range g.Specs {
+				typ, ok := s.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				if typ.Name.Name != typeName {
+					continue
+				}
+				t, ok := d.TypesInfo.Types[typ.Type].Type.(*types.Struct)
+				if !ok {
+					return fmt.Errorf("diffgen: expected struct type, instead got %T", t)
+				}
+				d.base = t
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// tagOpts holds the parsed contents of a `diffgen:"..."` struct tag.
+type tagOpts struct {
+	skip bool
+	name string
+	key  string
+	cmp  string
+}
+
+// parseTag parses the diffgen struct tag, if any, out of the raw tag
+// string reported by (*types.Struct).Tag. A bare `diffgen:"-"` skips the
+// field entirely; otherwise the tag is a comma-separated list of
+// name=, key= and cmp= directives. cmp is either "Func" (a function in the
+// generated package itself) or "import/path.Func" (a function in another
+// package, whose import path is threaded into the generated import block
+// by splitCmpTag).
+func parseTag(tag string) tagOpts {
+	var t tagOpts
+	raw, ok := reflect.StructTag(tag).Lookup("diffgen")
+	if !ok {
+		return t
+	}
+	for _, part := range strings.Split(raw, ",") {
+		switch {
+		case part == "-":
+			t.skip = true
+		case strings.HasPrefix(part, "name="):
+			t.name = strings.TrimPrefix(part, "name=")
+		case strings.HasPrefix(part, "key="):
+			t.key = strings.TrimPrefix(part, "key=")
+		case strings.HasPrefix(part, "cmp="):
+			t.cmp = strings.TrimPrefix(part, "cmp=")
+		}
+	}
+	return t
+}
+
+// splitCmpTag splits a diffgen:"cmp=..." tag value into the import path to
+// add to the generated file (empty if the comparator lives in the
+// generated package itself) and the selector to call in its place. The
+// tag only needs to be a bare "Func" when the comparator is in the same
+// package; otherwise it must be the full "import/path.Func", since a bare
+// package name (e.g. "moneyeq.Equal") gives goimports nothing reliable to
+// resolve an import from, and diffgen generates the code that needs it,
+// not a dependency goimports can already see in the build graph.
+//
+//	splitCmpTag("Equal") -> ("", "Equal")
+//	splitCmpTag("github.com/hhhapz/moneyeq.Equal") -> ("github.com/hhhapz/moneyeq", "moneyeq.Equal")
+func splitCmpTag(cmp string) (importPath, selector string) {
+	slash := strings.LastIndex(cmp, "/")
+	if slash < 0 {
+		return "", cmp
+	}
+	dot := strings.LastIndex(cmp[slash:], ".")
+	if dot < 0 {
+		return "", cmp
+	}
+	dot += slash
+	return cmp[:dot], cmp[slash+1:]
+}
+
+// pathKey joins the field-name segments of a path (dropping the
+// "[pointer]"/"[slice]"/"[map]" sentinels ProcessType inserts) into the
+// dotted key used by renames, sliceKeys, sliceElem and fieldCmp.
+func pathKey(path []string) string {
+	parts := make([]string, 0, len(path))
+	for _, item := range path {
+		if item == "" || item[0] == '[' {
+			continue
+		}
+		parts = append(parts, item)
+	}
+	return strings.Join(parts, ".")
+}
+
+func ProcessStruct(path []string, s *types.Struct, visited []*types.Named, depth int) [][]string {
+	if maxDepth > 0 && depth > maxDepth {
+		log.Printf("%s: max depth %d reached, falling back to a runtime comparison instead of recursing further", path, maxDepth)
+		cyclicTypes[pathKey(path)] = true
+		return [][]string{path}
+	}
+	var comparisons [][]string
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if !f.Exported() {
+			continue
+		}
+		tag := parseTag(s.Tag(i))
+		if tag.skip {
+			continue
+		}
+		nPath := make([]string, 0, len(path)+1)
+		nPath = append(nPath, path...)
+		nPath = append(nPath, f.Name())
+		key := pathKey(nPath)
+		if tag.name != "" {
+			renames[key] = tag.name
+		}
+		if tag.key != "" {
+			sliceKeys[key] = tag.key
+		}
+		if tag.cmp != "" {
+			importPath, selector := splitCmpTag(tag.cmp)
+			if strings.Contains(tag.cmp, "/") && importPath == "" {
+				log.Fatalf("diffgen: field %s: cmp=%q looks like an import path but names no function; expected import/path.Func", key, tag.cmp)
+			}
+			fieldCmp[key] = selector
+			if importPath != "" {
+				cmpImports[importPath] = true
+			}
+		}
+		res := ProcessType(nPath, f.Type(), visited, depth+1)
+		comparisons = append(comparisons, res...)
+	}
+	return comparisons
+}
+
+// hasEqualMethod reports whether t has a method `Equal(T) bool` where the
+// receiver and the single parameter are both t, e.g. time.Time.
+func hasEqualMethod(t *types.Named) bool {
+	ms := types.NewMethodSet(t)
+	for i := 0; i < ms.Len(); i++ {
+		fn := ms.At(i).Obj().(*types.Func)
+		if fn.Name() != "Equal" {
+			continue
+		}
+		sig := fn.Type().(*types.Signature)
+		if sig.Params().Len() != 1 || sig.Results().Len() != 1 {
+			continue
+		}
+		if !types.Identical(sig.Params().At(0).Type(), t) {
+			continue
+		}
+		if b, ok := sig.Results().At(0).Type().(*types.Basic); ok && b.Kind() == types.Bool {
+			return true
+		}
+	}
+	return false
+}
+
+// hasNoExportedFields reports whether t's underlying type is a struct with
+// zero exported fields, e.g. net/netip.Addr: ProcessStruct only ever walks
+// exported fields, so recursing into such a type produces no comparisons
+// at all, silently dropping the field rather than comparing it.
+func hasNoExportedFields(t *types.Named) bool {
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return false
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i).Exported() {
+			return false
+		}
+	}
+	return true
+}
+
+// hasStringMethod reports whether t has a `String() string` method.
+func hasStringMethod(t *types.Named) bool {
+	ms := types.NewMethodSet(t)
+	for i := 0; i < ms.Len(); i++ {
+		fn := ms.At(i).Obj().(*types.Func)
+		if fn.Name() != "String" {
+			continue
+		}
+		sig := fn.Type().(*types.Signature)
+		if sig.Params().Len() != 0 || sig.Results().Len() != 1 {
+			continue
+		}
+		if b, ok := sig.Results().At(0).Type().(*types.Basic); ok && b.Kind() == types.String {
+			return true
+		}
+	}
+	return false
+}
+
+func ProcessType(prefix []string, t types.Type, visited []*types.Named, depth int) [][]string {
+	switch t := t.(type) {
+	case *types.Pointer:
+		elem := t.Elem()
+		items := ProcessType(append(prefix, "[pointer]"), elem, visited, depth)
+		// methods
+		methods := types.NewMethodSet(t)
+		for i := 0; i < methods.Len(); i++ {
+			m := methods.At(i)
+			if !unicode.IsUpper(rune(m.Obj().Name()[0])) {
+				continue
+			}
+			prefix := slices.Clone(prefix)
+			items = append(items, append(prefix, "[method]", m.Obj().Name()))
+		}
+		return items
+	case *types.Named:
+		obj := t.Obj()
+		if obj.Pkg() != nil {
+			switch {
+			case obj.Pkg().Name() == "time" && obj.Name() == "Time":
+				return [][]string{prefix}
+			}
+		}
+		if hasEqualMethod(t) {
+			equalTypes[pathKey(prefix)] = true
+			return [][]string{prefix}
+		}
+		noFields := hasNoExportedFields(t)
+		if (!types.Comparable(t) || noFields) && hasStringMethod(t) {
+			stringerTypes[pathKey(prefix)] = true
+			return [][]string{prefix}
+		}
+		if noFields {
+			// A struct with no exported fields (e.g. net/netip.Addr) has
+			// nothing for ProcessStruct to walk into; without a Stringer
+			// to fall back to, compare it as a single leaf (with != if it
+			// is comparable, reflect.DeepEqual otherwise) instead of
+			// silently recursing into zero fields.
+			if !types.Comparable(t) {
+				cyclicTypes[pathKey(prefix)] = true
+			}
+			return [][]string{prefix}
+		}
+		if slices.Contains(visited, t) {
+			// t is already on the current recursion path: a cyclic type
+			// such as `type Node struct { Next *Node }`. Stop generating
+			// code for it here and fall back to a runtime equality check
+			// at this leaf instead of recursing forever.
+			cyclicTypes[pathKey(prefix)] = true
+			return [][]string{prefix}
+		}
+		return ProcessType(prefix, obj.Type().Underlying(), append(visited, t), depth)
+	case *types.Struct:
+		return ProcessStruct(prefix, t, visited, depth)
+	case *types.Slice:
+		elem := t.Elem()
+		if _, ok := sliceKeys[pathKey(prefix)]; ok {
+			sliceElem[pathKey(prefix)] = types.TypeString(elem, types.RelativeTo(typesPkg))
+		}
+		return ProcessType(append(prefix, "[slice]"), elem, visited, depth)
+	case *types.Map:
+		hasMap = true
+		_, ok := t.Key().Underlying().(*types.Basic)
+		if !ok {
+			log.Fatal("only basic types for slice supported at the moment")
+		}
+		return ProcessType(append(prefix, "[map]"), t.Elem(), visited, depth)
+	case *types.Array, *types.Basic:
+		return [][]string{prefix}
+	case *types.Interface, *types.Signature, *types.Chan:
+		return nil
+	default:
+		if skip {
+			log.Printf("%s (Skipping: %T)", prefix, t)
+			return nil
+		}
+		log.Fatalf("%s: unknown type %T to handle", prefix, t)
+		return nil
+	}
+}
+
+type Comparisons struct {
+	path    []string
+	Fields  []string
+	Methods []string
+	Structs map[string]Comparisons
+}
+
+func (c *Comparisons) Add(path []string) {
+	if len(path) == 1 {
+		c.Fields = append(c.Fields, path[0])
+		return
+	}
+	if len(path) == 2 && path[0] == "[method]" {
+		c.Methods = append(c.Methods, path[1])
+		return
+	}
+	if c.Structs == nil {
+		c.Structs = make(map[string]Comparisons)
+	}
+	subC, ok := c.Structs[path[0]]
+	if !ok {
+		subC.path = make([]string, 0, len(c.path)+1)
+		if path[0] != "[map]" && path[0] != "[slice]" {
+			subC.path = append(subC.path, c.path...)
+			subC.path = append(subC.path, path[0])
+		}
+		c.Fields = append(c.Fields, path[0])
+	}
+	subC.Add(path[1:])
+	c.Structs[path[0]] = subC
+}
+
+// dottedPath builds the quoted Diff.Path literal segments for a Go field
+// path, substituting in any diffgen:"name=..." rename recorded for a
+// segment along the way.
+func dottedPath(path []string) []string {
+	out := make([]string, 0, len(path))
+	var acc []string
+	for _, item := range path {
+		if item == "" || item[0] == '[' {
+			continue
+		}
+		acc = append(acc, item)
+		name := item
+		if r, ok := renames[strings.Join(acc, ".")]; ok {
+			name = r
+		}
+		out = append(out, "\""+name+"\"")
+	}
+	return out
+}
+
+func (c *Comparisons) WriteComparisons(w io.Writer, prefix string, usePrefix bool) {
+	for _, f := range c.Fields {
+		s, ok := c.Structs[f]
+		pathA := c.MakePath("a.", (c.path))
+		pathB := c.MakePath("b.", (c.path))
+		var hasIf bool
+		switch {
+		case f == "[pointer]":
+			p := dottedPath(c.path)
+			diffPath := "[]string{" + strings.Join(p, ", ") + "}"
+			if usePrefix {
+				diffPath = fmt.Sprintf("append(prefix, %s)", strings.Join(p, ", "))
+				if len(p) == 0 {
+					diffPath = "prefix"
+				}
+			}
+			if cyclicTypes[pathKey(c.path)] {
+				// The named type behind this pointer was already on the
+				// path when ProcessType walked here (e.g. Node.Next): there
+				// is no further Comparisons to descend into, so compare the
+				// pointee at runtime instead of recursing into an empty
+				// sub-Comparisons.
+				fmt.Fprintf(w, `%[1]sif %[2]s == nil && %[3]s != nil {
+	%[1]sdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))
+%[1]s} else if %[2]s != nil && %[3]s == nil {
+	%[1]sdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))
+%[1]s} else if %[2]s != nil && %[3]s != nil && !reflect.DeepEqual(%[2]s, %[3]s) {
+	%[1]sdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))
+%[1]s}
+`,
+					prefix, pathA, pathB, diffPath)
+				continue
+			}
+			hasIf = true
+			fmt.Fprintf(w, `%[1]sif %[2]s == nil && %[3]s != nil {
+	%[1]sdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))
+%[1]s} else if %[2]s != nil && %[3]s == nil {
+	%[1]sdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))
+%[1]s} else if %[2]s != nil && %[3]s != nil {`+"\n",
+				prefix, pathA, pathB, diffPath)
+			prefix = prefix + "\t"
+		case f == "[map]":
+			p := dottedPath(c.path)
+			k := `fmt.Sprint(k)`
+			diffPath := "[]string{" + strings.Join(p, ", ") + "}"
+			var diffPathKey string
+			if len(p) == 0 {
+				diffPathKey = "[]string{" + k + "}"
+			} else {
+				diffPathKey = diffPath[:len(diffPath)-1] + ", " + k + "}"
+			}
+			if usePrefix {
+				diffPath = fmt.Sprintf("append(prefix, %s)", strings.Join(p, ", "))
+				p = append(p, k)
+				diffPathKey = fmt.Sprintf("append(prefix, %s)", strings.Join(p, ", "))
+			}
+			if !ok {
+				fmt.Fprintf(w, `%[1]sif %[2]s == nil && %[3]s != nil {
+	%[1]sdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))
+%[1]s} else if %[2]s != nil && %[3]s == nil {
+	%[1]sdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))
+%[1]s} else if %[2]s != nil && %[3]s != nil {
+	%[1]sfor k, va := range %[2]s {
+		%[1]svb, ok := %[3]s[k]
+		%[1]sif !ok {
+			%[1]sdiff = append(diff, mkDiff(%[5]s, va, nil))
+		%[1]s} else if va != vb {
+			%[1]sdiff = append(diff, mkDiff(%[5]s, va, vb))
+		%[1]s}
+	%[1]s}
+	%[1]sfor k, vb := range %[3]s {
+		%[1]sif _, ok := %[2]s[k]; !ok { // Only append it if it's not in the original map, since if it is inside, it's already checked.
+			%[1]sdiff = append(diff, mkDiff(%[5]s, nil, vb))
+		%[1]s}
+	%[1]s}
+%[1]s}
+`,
+					prefix, pathA, pathB, diffPath, diffPathKey)
+			} else {
+				fmt.Fprintf(w, `%[1]sif %[2]s == nil && %[3]s != nil {
+	%[1]sdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))
+%[1]s} else if %[2]s != nil && %[3]s == nil {
+	%[1]sdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))
+%[1]s} else if %[2]s != nil && %[3]s != nil {
+	%[1]sfor k, va := range %[2]s {
+		%[1]svb, ok := %[3]s[k]
+		%[1]sif !ok {
+			%[1]sdiff = append(diff, mkDiff(%[5]s, va, nil))
+		%[1]s} else {
+			%[1]sa := va
+			%[1]sb := vb
+			%[1]sprefix := %[5]s
+`,
+					prefix, pathA, pathB, diffPath, diffPathKey)
+				prefix = prefix + "\t\t\t"
+				s.WriteComparisons(w, prefix, true)
+				prefix = prefix[:len(prefix)-3]
+				fmt.Fprintf(w, `		%[1]s}
+	%[1]s}
+	%[1]sfor k, vb := range %[3]s {
+		%[1]sif _, ok := %[2]s[k]; !ok { // Only append it if it's not in the original map, since if it is inside, it's already checked.
+			%[1]sdiff = append(diff, mkDiff(%[5]s, nil, vb))
+		%[1]s}
+	%[1]s}
+%[1]s}
+`,
+					prefix, pathA, pathB, diffPath, diffPathKey)
+				continue
+			}
+			continue
+		case f == "[slice]":
+			if keyField, keyed := sliceKeys[pathKey(c.path)]; keyed && ok {
+				c.writeKeyedSliceComparisons(w, s, prefix, pathA, pathB, keyField, usePrefix)
+				continue
+			}
+			p := dottedPath(c.path)
+			diffPath := "[]string{" + strings.Join(p, ", ") + "}"
+			var diffPathIdx string
+			if len(p) == 0 {
+				diffPathIdx = "[]string{strconv.Itoa(i)}"
+			} else {
+				diffPathIdx = diffPath[:len(diffPath)-1] + ", strconv.Itoa(i)}"
+			}
+			if usePrefix {
+				diffPath = "prefix"
+				if len(p) > 0 {
+					diffPath = fmt.Sprintf("append(prefix, %s)", strings.Join(p, ", "))
+				}
+				p = append(p, "strconv.Itoa(i)")
+				diffPathIdx = fmt.Sprintf("append(prefix, %s)", strings.Join(p, ", "))
+			}
+			if !ok {
+				fmt.Fprintf(w, `%[1]sif len(%[2]s) == len(%[3]s) {
+	%[1]sfor i := range %[2]s {
+		%[1]sif %[2]s[i] != %[3]s[i] {
+			%[1]sdiff = append(diff, mkDiff(%[5]s, %[2]s[i], %[3]s[i]))
+		%[1]s}
+	%[1]s}
+%[1]s} else {
+	%[1]sdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))
+%[1]s}
+`,
+					prefix, pathA, pathB, diffPath, diffPathIdx)
+			} else {
+				fmt.Fprintf(w, `%[1]sif len(%[2]s) == len(%[3]s) {
+	%[1]sfor i := range %[2]s {
+		%[1]sa := %[2]s[i]
+		%[1]sb := %[3]s[i]
+		%[1]sprefix := %[4]s
+`,
+					prefix, pathA, pathB, diffPathIdx)
+				prefix = prefix + "\t\t"
+				s.WriteComparisons(w, prefix, true)
+				prefix = prefix[:len(prefix)-2]
+				fmt.Fprintf(w, `	%[1]s}
+%[1]s} else {
+	%[1]sdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))
+%[1]s}
+`,
+					prefix, pathA, pathB, diffPath)
+			}
+			continue
+		case !ok:
+			pathA += "." + f
+			pathB += "." + f
+
+			fp := make([]string, 0, len(c.path)+1)
+			fp = append(fp, c.path...)
+			fp = append(fp, f)
+			p := dottedPath(fp)
+			diffPath := "[]string{" + strings.Join(p, ", ") + "}"
+			if usePrefix {
+				diffPath = fmt.Sprintf("append(prefix, %s)", strings.Join(p, ", "))
+			}
+			switch fieldKey := pathKey(fp); {
+			case fieldCmp[fieldKey] != "":
+				fmt.Fprintf(w, "%[1]sif !%[5]s(%[2]s, %[3]s) {\n%[1]s\tdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))\n%[1]s}\n",
+					prefix, pathA, pathB, diffPath, fieldCmp[fieldKey])
+			case equalTypes[fieldKey]:
+				fmt.Fprintf(w, "%[1]sif !%[2]s.Equal(%[3]s) {\n%[1]s\tdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))\n%[1]s}\n",
+					prefix, pathA, pathB, diffPath)
+			case stringerTypes[fieldKey]:
+				fmt.Fprintf(w, "%[1]sif %[2]s.String() != %[3]s.String() {\n%[1]s\tdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))\n%[1]s}\n",
+					prefix, pathA, pathB, diffPath)
+			case cyclicTypes[fieldKey]:
+				fmt.Fprintf(w, "%[1]sif !reflect.DeepEqual(%[2]s, %[3]s) {\n%[1]s\tdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))\n%[1]s}\n",
+					prefix, pathA, pathB, diffPath)
+			default:
+				fmt.Fprintf(w, "%[1]sif %[2]s != %[3]s {\n%[1]s\tdiff = append(diff, mkDiff(%[4]s, %[2]s, %[3]s))\n%[1]s}\n",
+					prefix, pathA, pathB, diffPath)
+			}
+			continue
+		}
+		s.WriteComparisons(w, prefix, usePrefix)
+		switch {
+		case hasIf:
+			prefix = prefix[:len(prefix)-1]
+			fmt.Fprintf(w, prefix+"}\n")
+		}
+	}
+	if !methods || len(c.Methods) == 0 {
+		return
+	}
+	pathB := c.MakePath("b.", (c.path))
+	fmt.Fprintf(w, "%[1]sif %[2]s != nil {\n",
+		prefix, pathB)
+	for _, m := range c.Methods {
+		pathB := c.MakePath("b.", (c.path))
+		p := dottedPath(c.path)
+		p = append(p, "\""+m+"\"")
+		diffPath := "[]string{" + strings.Join(p, ", ") + "}"
+		if usePrefix {
+			diffPath = fmt.Sprintf("append(prefix, %s)", strings.Join(p, ", "))
+		}
+		fmt.Fprintf(w, "%[1]s\tdiff = append(diff, mkDiff(%[4]s, nil, %[3]s))\n",
+			prefix, "", pathB+"."+m, diffPath)
+	}
+	fmt.Fprintf(w, "%[1]s}\n",
+		prefix, pathB)
+}
+
+// writeKeyedSliceComparisons emits a map-keyed diff for a
+// diffgen:"key=..." slice-of-struct field instead of the default
+// index-parallel loop, so reordering or resizing the slice reports
+// per-element "added"/"removed"/"changed" diffs keyed by keyField rather
+// than a single whole-slice diff.
+func (c *Comparisons) writeKeyedSliceComparisons(w io.Writer, s Comparisons, prefix, pathA, pathB, keyField string, usePrefix bool) {
+	elemType := sliceElem[pathKey(c.path)]
+	p := dottedPath(c.path)
+	diffPath := "[]string{" + strings.Join(p, ", ") + "}"
+	k := `fmt.Sprint(k)`
+	var diffPathKey string
+	if len(p) == 0 {
+		diffPathKey = "[]string{" + k + "}"
+	} else {
+		diffPathKey = diffPath[:len(diffPath)-1] + ", " + k + "}"
+	}
+	if usePrefix {
+		diffPath = "prefix"
+		if len(p) > 0 {
+			diffPath = fmt.Sprintf("append(prefix, %s)", strings.Join(p, ", "))
+		}
+		p = append(p, k)
+		diffPathKey = fmt.Sprintf("append(prefix, %s)", strings.Join(p, ", "))
+	}
+	fmt.Fprintf(w, `%[1]s{
+	%[1]saKeyed := make(map[any]%[6]s, len(%[2]s))
+	%[1]sfor _, v := range %[2]s {
+		%[1]saKeyed[v.%[7]s] = v
+	%[1]s}
+	%[1]sbKeyed := make(map[any]%[6]s, len(%[3]s))
+	%[1]sfor _, v := range %[3]s {
+		%[1]sbKeyed[v.%[7]s] = v
+	%[1]s}
+	%[1]sfor k, va := range aKeyed {
+		%[1]svb, ok := bKeyed[k]
+		%[1]sif !ok {
+			%[1]sdiff = append(diff, mkDiff(%[5]s, va, nil))
+		%[1]s} else {
+			%[1]sa := va
+			%[1]sb := vb
+			%[1]sprefix := %[5]s
+`,
+		prefix, pathA, pathB, diffPath, diffPathKey, elemType, keyField)
+	prefix = prefix + "\t\t\t"
+	s.WriteComparisons(w, prefix, true)
+	prefix = prefix[:len(prefix)-3]
+	fmt.Fprintf(w, `		%[1]s}
+	%[1]s}
+	%[1]sfor k, vb := range bKeyed {
+		%[1]sif _, ok := aKeyed[k]; !ok {
+			%[1]sdiff = append(diff, mkDiff(%[5]s, nil, vb))
+		%[1]s}
+	%[1]s}
+%[1]s}
+`,
+		prefix, pathA, pathB, diffPath, diffPathKey)
+}
+
+func (c *Comparisons) MakePath(start string, path []string) string {
+	out := start
+	for _, item := range path {
+		if item == "[pointer]" {
+			out = "(*" + strings.TrimRight(out, ".") + ")."
+			continue
+		}
+		out += item + "."
+	}
+	return strings.TrimRight(out, ".")
+}
+
+func isDirectory(name string) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return info.IsDir()
+}